@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	sprig "github.com/Masterminds/sprig"
+	"github.com/ghodss/yaml"
+)
+
+// Engine names accepted by the --engine flag.
+const (
+	EngineKexpand         = "kexpand"
+	EngineGoTemplate      = "gotemplate"
+	EngineGoTemplateSprig = "gotemplate-sprig"
+)
+
+// MissingKeyMode controls what an Engine does when it encounters a
+// placeholder whose key isn't present in the values map (and, if --env is
+// set, isn't present in the environment either).
+type MissingKeyMode string
+
+const (
+	// MissingKeyStrict fails the expansion. This is the default.
+	MissingKeyStrict MissingKeyMode = "strict"
+	// MissingKeyAllow leaves the original placeholder text untouched.
+	MissingKeyAllow MissingKeyMode = "allow-missing"
+	// MissingKeyEmpty substitutes an empty string.
+	MissingKeyEmpty MissingKeyMode = "default-empty"
+)
+
+// ValueFormat controls how a scalar value is rendered in the quoted $(key)
+// form, for values that don't survive naive %v-and-quote formatting intact.
+type ValueFormat string
+
+const (
+	// ValueFormatDefault renders "%v" wrapped in double quotes, as before.
+	ValueFormatDefault ValueFormat = ""
+	// ValueFormatJSONEscape JSON-encodes the value's string form, so quotes,
+	// newlines, and other special characters are escaped correctly.
+	ValueFormatJSONEscape ValueFormat = "json-escape"
+	// ValueFormatYAMLBlockScalar renders the value as a YAML literal block
+	// scalar ("|") indented under the match's column, for embedding
+	// multi-line values (certificates, keys) without escaping at all.
+	ValueFormatYAMLBlockScalar ValueFormat = "yaml-block-scalar"
+)
+
+// ExpandOptions carries the per-run settings that affect how an Engine
+// resolves and reports on missing keys.
+type ExpandOptions struct {
+	// File is the name of the source being expanded, used in error messages.
+	// It is "<stdin>" when reading from standard input.
+	File string
+
+	MissingKeyMode MissingKeyMode
+
+	// Env, when set, falls back to os.Getenv on the upper-cased key (with
+	// "." replaced by "_") before a key is declared missing.
+	Env bool
+
+	// ValueFormat controls scalar formatting in the quoted $(key) form.
+	ValueFormat ValueFormat
+}
+
+// Engine expands a template against a set of values. Implementations are
+// free to interpret src however they like; kexpand ships a regex-based
+// engine for backwards compatibility and text/template-based engines for
+// users who want conditionals, ranges, and helper functions.
+type Engine interface {
+	Expand(src []byte, values map[string]interface{}, opts ExpandOptions) ([]byte, error)
+}
+
+// newEngine looks up the Engine registered under name. An empty name selects
+// the default kexpand engine.
+func newEngine(name string) (Engine, error) {
+	switch name {
+	case "", EngineKexpand:
+		return kexpandEngine{}, nil
+	case EngineGoTemplate:
+		return goTemplateEngine{}, nil
+	case EngineGoTemplateSprig:
+		return goTemplateEngine{sprig: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q (expected one of %q, %q, %q)", name, EngineKexpand, EngineGoTemplate, EngineGoTemplateSprig)
+	}
+}
+
+// kexpandEngine is the original $(key) / $((key)) / {{key}} regex substitution.
+type kexpandEngine struct{}
+
+func (kexpandEngine) Expand(src []byte, values map[string]interface{}, opts ExpandOptions) ([]byte, error) {
+	return expandRegex(src, values, opts)
+}
+
+// goTemplateEngine renders src with the standard library text/template
+// package, optionally with the sprig FuncMap mixed in. It doesn't support
+// --env or --allow-missing/--default-empty distinctly: text/template only
+// offers "error" or "zero value" for a missing key, so both non-strict modes
+// map to the latter. Since values is a map[string]interface{}, a missing key
+// then renders as "<no value>", not as an empty string or the placeholder.
+type goTemplateEngine struct {
+	sprig bool
+}
+
+func (e goTemplateEngine) Expand(src []byte, values map[string]interface{}, opts ExpandOptions) ([]byte, error) {
+	t := template.New("kexpand")
+	if opts.MissingKeyMode == MissingKeyStrict {
+		t = t.Option("missingkey=error")
+	} else {
+		t = t.Option("missingkey=zero")
+	}
+	if e.sprig {
+		t = t.Funcs(sprig.TxtFuncMap())
+		t = t.Funcs(helmFuncs())
+	}
+
+	t, err := t.Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("%s: error executing template: %v", opts.File, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// helmFuncs adds the Helm-style "toYaml" helper sprig itself doesn't define,
+// so gotemplate-sprig templates can render structured values
+// (e.g. `{{ toYaml .data }}`).
+func helmFuncs() template.FuncMap {
+	return template.FuncMap{
+		"toYaml": func(v interface{}) string {
+			b, err := yaml.Marshal(v)
+			if err != nil {
+				return ""
+			}
+			return strings.TrimSuffix(string(b), "\n")
+		},
+	}
+}
+
+// substitutionForm describes one of kexpand's placeholder syntaxes.
+type substitutionForm struct {
+	re     *regexp.Regexp
+	key    func(match []byte) string
+	quoted bool
+}
+
+var substitutionForms = []substitutionForm{
+	{
+		// quoted form: $(key) => "value"
+		re:     regexp.MustCompile(`\$\([a-zA-Z0-9_\.]+\)`),
+		key:    func(match []byte) string { return string(match[2 : len(match)-1]) },
+		quoted: true,
+	},
+	{
+		// unquoted form: $((key)) => value
+		re:  regexp.MustCompile(`\$\(\([a-zA-Z0-9_\.]+\)\)`),
+		key: func(match []byte) string { return string(match[3 : len(match)-2]) },
+	},
+	{
+		// legacy form: {{key}} => value
+		re:  regexp.MustCompile(`\{\{[a-zA-Z0-9_\.]+\}\}`),
+		key: func(match []byte) string { return string(match[2 : len(match)-2]) },
+	},
+}
+
+// expandRegex implements the historical kexpand substitution rules described
+// by substitutionForms. key may be a dotted path (e.g.
+// "database.primary.host") into a nested values tree. When the resolved
+// value is itself a map or slice, the quoted form serializes it as a quoted
+// JSON string and the unquoted/legacy forms serialize it as inline YAML,
+// indented to line up with the column the match started at.
+//
+// Every missing key is collected rather than failing on the first one, so
+// opts.MissingKeyMode == MissingKeyStrict (the default) reports every
+// offending placeholder at once as a MissingKeyErrors.
+func expandRegex(src []byte, values map[string]interface{}, opts ExpandOptions) ([]byte, error) {
+	expanded := src
+	var missing MissingKeyErrors
+
+	for _, form := range substitutionForms {
+		expanded = replaceWithPosition(expanded, form.re, func(match []byte, line, column int) []byte {
+			key := form.key(match)
+			replacement, ok := resolveKeyOrEnv(values, key, opts.Env)
+			if !ok {
+				switch opts.MissingKeyMode {
+				case MissingKeyAllow:
+					return match
+				case MissingKeyEmpty:
+					return nil
+				default:
+					missing = append(missing, &MissingKeyError{Key: key, File: opts.File, Line: line, Column: column})
+					return match
+				}
+			}
+
+			if isComposite(replacement) {
+				var s string
+				var err error
+				if form.quoted {
+					s, err = serializeQuoted(replacement)
+				} else {
+					s, err = serializeInline(replacement, column)
+				}
+				if err != nil {
+					missing = append(missing, &MissingKeyError{Key: key, File: opts.File, Line: line, Column: column})
+					return match
+				}
+				return []byte(s)
+			}
+
+			if form.quoted {
+				switch opts.ValueFormat {
+				case ValueFormatJSONEscape:
+					b, err := json.Marshal(fmt.Sprintf("%v", replacement))
+					if err != nil {
+						missing = append(missing, &MissingKeyError{Key: key, File: opts.File, Line: line, Column: column})
+						return match
+					}
+					return b
+				case ValueFormatYAMLBlockScalar:
+					return []byte(serializeBlockScalar(replacement, column))
+				default:
+					return []byte(fmt.Sprintf("\"%v\"", replacement))
+				}
+			}
+			return []byte(fmt.Sprintf("%v", replacement))
+		})
+	}
+
+	if len(missing) > 0 {
+		return nil, missing
+	}
+
+	return expanded, nil
+}
+
+// replaceWithPosition is like regexp.ReplaceAllFunc, except replace also
+// receives the 1-based line and 0-based column the match starts at, which
+// missing-key reporting and composite value indentation both need.
+func replaceWithPosition(src []byte, re *regexp.Regexp, replace func(match []byte, line, column int) []byte) []byte {
+	locs := re.FindAllIndex(src, -1)
+	if locs == nil {
+		return src
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range locs {
+		start, end := loc[0], loc[1]
+		buf.Write(src[last:start])
+
+		line := 1 + bytes.Count(src[:start], []byte{'\n'})
+		column := start - bytes.LastIndexByte(src[:start], '\n') - 1
+		buf.Write(replace(src[start:end], line, column))
+
+		last = end
+	}
+	buf.Write(src[last:])
+
+	return buf.Bytes()
+}
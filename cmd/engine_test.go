@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandRegexStrictAggregatesMissingKeys(t *testing.T) {
+	src := []byte("host: $(host)\nport: $(port)\nname: $(name)\n")
+	values := map[string]interface{}{"name": "svc"}
+
+	_, err := expandRegex(src, values, ExpandOptions{File: "config.yaml", MissingKeyMode: MissingKeyStrict})
+	if err == nil {
+		t.Fatal("expandRegex returned no error for missing keys")
+	}
+
+	missing, ok := err.(MissingKeyErrors)
+	if !ok {
+		t.Fatalf("expandRegex error is %T, want MissingKeyErrors", err)
+	}
+	if len(missing) != 2 {
+		t.Fatalf("got %d missing key errors, want 2: %v", len(missing), missing)
+	}
+
+	if missing[0].Key != "host" || missing[0].File != "config.yaml" || missing[0].Line != 1 {
+		t.Errorf("unexpected first missing key error: %+v", missing[0])
+	}
+	if missing[1].Key != "port" || missing[1].Line != 2 {
+		t.Errorf("unexpected second missing key error: %+v", missing[1])
+	}
+}
+
+func TestExpandRegexAllowMissingLeavesPlaceholder(t *testing.T) {
+	src := []byte("host: $(host)\n")
+
+	out, err := expandRegex(src, nil, ExpandOptions{MissingKeyMode: MissingKeyAllow})
+	if err != nil {
+		t.Fatalf("expandRegex returned error: %v", err)
+	}
+	if string(out) != string(src) {
+		t.Fatalf("expandRegex = %q; want unchanged %q", out, src)
+	}
+}
+
+func TestExpandRegexDefaultEmptySubstitutesEmptyString(t *testing.T) {
+	src := []byte(`host: $(host)`)
+
+	out, err := expandRegex(src, nil, ExpandOptions{MissingKeyMode: MissingKeyEmpty})
+	if err != nil {
+		t.Fatalf("expandRegex returned error: %v", err)
+	}
+	if want := `host: `; string(out) != want {
+		t.Fatalf("expandRegex = %q; want %q", out, want)
+	}
+}
+
+func TestExpandRegexResolvesPresentKeys(t *testing.T) {
+	src := []byte("host: $(host)\nport: $((port))\n")
+	values := map[string]interface{}{"host": "db.example.com", "port": 5432}
+
+	out, err := expandRegex(src, values, ExpandOptions{MissingKeyMode: MissingKeyStrict})
+	if err != nil {
+		t.Fatalf("expandRegex returned error: %v", err)
+	}
+	if want := "host: \"db.example.com\"\nport: 5432\n"; string(out) != want {
+		t.Fatalf("expandRegex = %q; want %q", out, want)
+	}
+}
+
+func TestExpandRegexEnvFallback(t *testing.T) {
+	t.Setenv("HOST", "from-env")
+	src := []byte("host: $(host)")
+
+	out, err := expandRegex(src, nil, ExpandOptions{MissingKeyMode: MissingKeyStrict, Env: true})
+	if err != nil {
+		t.Fatalf("expandRegex returned error: %v", err)
+	}
+	if want := `host: "from-env"`; string(out) != want {
+		t.Fatalf("expandRegex = %q; want %q", out, want)
+	}
+}
+
+func TestGoTemplateEngineExpandsValues(t *testing.T) {
+	e := goTemplateEngine{}
+	src := []byte("host: {{ .host }}\n")
+	values := map[string]interface{}{"host": "db.example.com"}
+
+	out, err := e.Expand(src, values, ExpandOptions{MissingKeyMode: MissingKeyStrict})
+	if err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+	if want := "host: db.example.com\n"; string(out) != want {
+		t.Fatalf("Expand = %q; want %q", out, want)
+	}
+}
+
+func TestGoTemplateEngineStrictFailsOnMissingKey(t *testing.T) {
+	e := goTemplateEngine{}
+	src := []byte("host: {{ .host }}\n")
+
+	if _, err := e.Expand(src, nil, ExpandOptions{MissingKeyMode: MissingKeyStrict}); err == nil {
+		t.Fatal("Expand returned no error for a missing key in strict mode")
+	}
+}
+
+func TestGoTemplateEngineSprigToYaml(t *testing.T) {
+	e := goTemplateEngine{sprig: true}
+	src := []byte("{{ .data | toYaml }}\n")
+	values := map[string]interface{}{"data": map[string]interface{}{"a": 1, "b": "two"}}
+
+	out, err := e.Expand(src, values, ExpandOptions{MissingKeyMode: MissingKeyStrict})
+	if err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+	if want := "a: 1\nb: two\n"; string(out) != want {
+		t.Fatalf("Expand = %q; want %q", out, want)
+	}
+}
+
+func TestGoTemplateEngineWithoutSprigLacksToYaml(t *testing.T) {
+	e := goTemplateEngine{}
+	src := []byte("{{ .data | toYaml }}\n")
+
+	if _, err := e.Expand(src, nil, ExpandOptions{MissingKeyMode: MissingKeyStrict}); err == nil {
+		t.Fatal("Expand returned no error for toYaml without --engine gotemplate-sprig")
+	}
+}
+
+func TestMissingKeyErrorsErrorJoinsEveryEntry(t *testing.T) {
+	errs := MissingKeyErrors{
+		&MissingKeyError{Key: "host", File: "a.yaml", Line: 1, Column: 6},
+		&MissingKeyError{Key: "port", File: "a.yaml", Line: 2, Column: 6},
+	}
+
+	msg := errs.Error()
+	if !strings.Contains(msg, "host") || !strings.Contains(msg, "port") {
+		t.Fatalf("MissingKeyErrors.Error() = %q; want it to mention both keys", msg)
+	}
+	if got := len(strings.Split(msg, "\n")); got != 2 {
+		t.Fatalf("MissingKeyErrors.Error() has %d lines; want 2", got)
+	}
+}
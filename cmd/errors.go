@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingKeyError describes a single placeholder that could not be resolved
+// against the values map, pinpointed by its location in the source file.
+type MissingKeyError struct {
+	Key    string
+	File   string
+	Line   int
+	Column int
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: key not found: %q", e.File, e.Line, e.Column, e.Key)
+}
+
+// MissingKeyErrors aggregates every MissingKeyError found while expanding a
+// single source, so users see every offending placeholder in one pass
+// instead of fixing them one at a time.
+type MissingKeyErrors []*MissingKeyError
+
+func (e MissingKeyErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
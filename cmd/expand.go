@@ -4,10 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 
-	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 )
@@ -17,8 +16,28 @@ type ExpandCmd struct {
 
 	SourceFiles []string
 	Values      []string
+	ValuesFrom  []string
+	Engine      string
 
 	IgnoreMissingFiles bool
+	Redact             bool
+
+	Strict       bool
+	AllowMissing bool
+	DefaultEmpty bool
+	Env          bool
+
+	OutputDir string
+	InPlace   bool
+	Suffix    string
+
+	Watch    bool
+	OnChange string
+
+	Validate        bool
+	OutputFormat    string
+	JSONEscape      bool
+	YAMLBlockScalar bool
 }
 
 var expandCmd = ExpandCmd{
@@ -35,6 +54,22 @@ func init() {
 	cmd.Flags().StringSliceVarP(&expandCmd.SourceFiles, "file", "f", nil, "files containing values to substitute")
 	cmd.Flags().StringSliceVarP(&expandCmd.Values, "value", "k", nil, "key=value pairs to substitute")
 	cmd.Flags().BoolVarP(&expandCmd.IgnoreMissingFiles, "ignore-missing-files", "i", false, "ignore source files that are not found")
+	cmd.Flags().StringArrayVar(&expandCmd.ValuesFrom, "values-from", nil, "additional values provider URIs: file://, env://, vault://, awssm://, ssm://, or json:- for stdin JSON; merged left to right")
+	cmd.Flags().BoolVar(&expandCmd.Redact, "redact", false, "scrub sensitive provider values (env/vault/awssm/ssm) from error output")
+	cmd.Flags().StringVar(&expandCmd.Engine, "engine", EngineKexpand, "template engine to use: kexpand, gotemplate, or gotemplate-sprig")
+	cmd.Flags().BoolVar(&expandCmd.Strict, "strict", false, "fail if any key is missing, reporting every occurrence (default)")
+	cmd.Flags().BoolVar(&expandCmd.AllowMissing, "allow-missing", false, "leave the original placeholder untouched if a key is missing")
+	cmd.Flags().BoolVar(&expandCmd.DefaultEmpty, "default-empty", false, "substitute an empty string if a key is missing")
+	cmd.Flags().BoolVar(&expandCmd.Env, "env", false, "fall back to environment variables (upper-cased, dots replaced with underscores) for missing keys")
+	cmd.Flags().StringVar(&expandCmd.OutputDir, "output-dir", "", "mirror expanded files into this directory instead of writing to stdout")
+	cmd.Flags().BoolVar(&expandCmd.InPlace, "in-place", false, "overwrite each source file with its expanded contents")
+	cmd.Flags().StringVar(&expandCmd.Suffix, "suffix", "", "suffix to append to each output filename, e.g. \".out\"")
+	cmd.Flags().BoolVar(&expandCmd.Watch, "watch", false, "watch the given files/directories and re-expand on change")
+	cmd.Flags().StringVar(&expandCmd.OnChange, "on-change", "", "command to run after each re-expansion in --watch mode")
+	cmd.Flags().BoolVar(&expandCmd.Validate, "validate", false, "parse the expanded output as one or more YAML documents and fail if any are invalid")
+	cmd.Flags().StringVar(&expandCmd.OutputFormat, "output-format", "", "re-serialize the expanded output canonically: json, yaml, or json-lines")
+	cmd.Flags().BoolVar(&expandCmd.JSONEscape, "json-escape", false, "JSON-escape values substituted with the $(key) form")
+	cmd.Flags().BoolVar(&expandCmd.YAMLBlockScalar, "yaml-block-scalar", false, "render values substituted with the $(key) form as a YAML block scalar")
 
 	cmd.Run = func(cmd *cobra.Command, args []string) {
 		err := expandCmd.Run(args)
@@ -44,141 +79,305 @@ func init() {
 	}
 }
 
-func (c *ExpandCmd) Run(args []string) error {
-	values, err := c.parseValues()
+func (c *ExpandCmd) Run(args []string) (err error) {
+	var sensitive []string
+	if c.Redact {
+		defer func() {
+			err = redactError(err, sensitive)
+		}()
+	}
+
+	var values map[string]interface{}
+	values, sensitive, err = c.parseValues()
 	if err != nil {
 		return err
 	}
 
+	sensitiveValues := make(map[string]bool, len(sensitive))
+	for _, s := range sensitive {
+		sensitiveValues[s] = true
+	}
 	for k, v := range values {
+		if sensitiveValues[fmt.Sprintf("%v", v)] {
+			glog.V(2).Infof("\t%q=%q", k, "REDACTED")
+			continue
+		}
 		glog.V(2).Infof("\t%q=%q", k, v)
 	}
 
-	var src []byte
+	mode, err := c.missingKeyMode()
+	if err != nil {
+		return err
+	}
+
+	valueFormat, err := c.valueFormat()
+	if err != nil {
+		return err
+	}
+
+	engine, err := newEngine(c.Engine)
+	if err != nil {
+		return err
+	}
+
+	run := expandRun{engine: engine, mode: mode, valueFormat: valueFormat}
+
+	if c.Watch {
+		return c.watch(args, values, run)
+	}
+
 	if len(args) == 0 {
-		src, err = ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("error reading from stdin: %v", err)
-		}
-	} else if len(args) == 1 {
-		src, err = ioutil.ReadFile(args[0])
-		if err != nil {
-			return fmt.Errorf("error reading file %q: %v", args[0], err)
-		}
-	} else {
-		return fmt.Errorf("expected exactly one argument, a path to a file to expand")
+		return c.expandStdin(values, run)
 	}
 
-	expanded := src
-	{
-		// quoted form: $(key) => "value"
-		re := regexp.MustCompile(`\$\([a-z_\.]+\)`)
-		expandFunction := func(match []byte) []byte {
-			if match[0] != '$' || match[1] != '(' || match[len(match)-1] != ')' {
-				glog.Fatalf("unexpected match: %q", string(match))
-			}
-			key := string(match[2 : len(match)-1])
-			replacement := values[key]
-			if replacement == nil {
-				err = fmt.Errorf("key not found: %q", key)
-				return match
-			}
-			s := fmt.Sprintf("\"%v\"", replacement)
-			return []byte(s)
+	files, err := collectSourceFiles(args)
+	if err != nil {
+		return err
+	}
+
+	if !c.writesToDestination() {
+		if len(files) != 1 {
+			return fmt.Errorf("expanding multiple files requires --in-place, --output-dir, or --suffix")
 		}
+		return c.expandFileToStdout(files[0], values, run)
+	}
 
-		expanded = re.ReplaceAllFunc(expanded, expandFunction)
-		if err != nil {
+	for _, f := range files {
+		if _, _, err := c.expandFileToDestination(f, values, run); err != nil {
 			return err
 		}
 	}
 
-	{
-		// unquoted form: $((key)) => value
+	return nil
+}
 
-		re := regexp.MustCompile(`\$\(\([a-z_\.]+\)\)`)
-		expandFunction := func(match []byte) []byte {
-			if match[0] != '$' || match[1] != '(' || match[2] != '(' || match[len(match)-1] != ')' || match[len(match)-2] != ')' {
-				glog.Fatalf("unexpected match: %q", string(match))
-			}
-			key := string(match[3 : len(match)-2])
-			replacement := values[key]
-			if replacement == nil {
-				err = fmt.Errorf("key not found: %q", key)
-				return match
-			}
-			s := fmt.Sprintf("%v", replacement)
-			return []byte(s)
-		}
+// expandRun bundles the engine and per-run options that every expansion in a
+// single invocation shares, so helper methods don't accumulate an
+// ever-growing parameter list.
+type expandRun struct {
+	engine      Engine
+	mode        MissingKeyMode
+	valueFormat ValueFormat
+}
 
-		expanded = re.ReplaceAllFunc(expanded, expandFunction)
-		if err != nil {
-			return err
+// valueFormat derives a single ValueFormat from the mutually exclusive
+// --json-escape/--yaml-block-scalar flags.
+func (c *ExpandCmd) valueFormat() (ValueFormat, error) {
+	if c.JSONEscape && c.YAMLBlockScalar {
+		return "", fmt.Errorf("only one of --json-escape, --yaml-block-scalar may be set")
+	}
+	if c.JSONEscape {
+		return ValueFormatJSONEscape, nil
+	}
+	if c.YAMLBlockScalar {
+		return ValueFormatYAMLBlockScalar, nil
+	}
+	return ValueFormatDefault, nil
+}
+
+// writesToDestination reports whether the current flags produce a file on
+// disk per input (--in-place/--output-dir/--suffix) rather than a single
+// stream to stdout.
+func (c *ExpandCmd) writesToDestination() bool {
+	return c.InPlace || c.OutputDir != "" || c.Suffix != ""
+}
+
+func (c *ExpandCmd) expandStdin(values map[string]interface{}, run expandRun) error {
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("error reading from stdin: %v", err)
+	}
+
+	expanded, err := c.expandSource(src, "<stdin>", values, run)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stdout.Write(expanded); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+
+	return nil
+}
+
+func (c *ExpandCmd) expandFileToStdout(file string, values map[string]interface{}, run expandRun) error {
+	expanded, err := c.expandFile(file, values, run)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stdout.Write(expanded); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+
+	return nil
+}
+
+// expandFileToDestination expands file and writes it to its computed
+// destination path, returning that path and the exact bytes written so
+// callers (e.g. --watch) can tell their own writes apart from external
+// edits.
+func (c *ExpandCmd) expandFileToDestination(file string, values map[string]interface{}, run expandRun) (string, []byte, error) {
+	expanded, err := c.expandFile(file, values, run)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dest := c.destinationPath(file)
+	if dir := filepath.Dir(dest); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", nil, fmt.Errorf("error creating directory %q: %v", dir, err)
 		}
 	}
 
-	{
-		// legacy form: {{key}} => value
+	if err := ioutil.WriteFile(dest, expanded, 0644); err != nil {
+		return "", nil, fmt.Errorf("error writing file %q: %v", dest, err)
+	}
 
-		re := regexp.MustCompile(`\{\{[a-z_\.]+\}\}`)
-		expandFunction := func(match []byte) []byte {
-			if match[0] != '{' || match[1] != '{' || match[len(match)-1] != '}' || match[len(match)-2] != '}' {
-				glog.Fatalf("unexpected match: %q", string(match))
-			}
-			key := string(match[2 : len(match)-2])
-			replacement := values[key]
-			if replacement == nil {
-				err = fmt.Errorf("key not found: %q", key)
-				return match
+	glog.V(1).Infof("wrote %q", dest)
+	return dest, expanded, nil
+}
+
+func (c *ExpandCmd) expandFile(file string, values map[string]interface{}, run expandRun) ([]byte, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %q: %v", file, err)
+	}
+
+	return c.expandSource(src, file, values, run)
+}
+
+// expandSource runs the engine and then, per --validate/--output-format,
+// checks and re-serializes the result. This is a thin wrapper around the
+// Expand function shared with the serve command, binding it to this
+// invocation's flags.
+func (c *ExpandCmd) expandSource(src []byte, file string, values map[string]interface{}, run expandRun) ([]byte, error) {
+	return Expand(run.engine, src, values, ExpandOptions{
+		File:           file,
+		MissingKeyMode: run.mode,
+		Env:            c.Env,
+		ValueFormat:    run.valueFormat,
+	}, c.Validate, c.OutputFormat)
+}
+
+// destinationPath computes where an expanded copy of src should be written
+// given --output-dir/--suffix. --in-place with neither set writes back to
+// src itself.
+func (c *ExpandCmd) destinationPath(src string) string {
+	dest := src
+	if c.Suffix != "" {
+		dest += c.Suffix
+	}
+	if c.OutputDir != "" {
+		dest = filepath.Join(c.OutputDir, dest)
+	}
+	return dest
+}
+
+// collectSourceFiles expands args (which may be file paths, directories to
+// walk recursively, or glob patterns) into a flat list of file paths.
+func collectSourceFiles(args []string) ([]string, error) {
+	var files []string
+
+	for _, arg := range args {
+		info, statErr := os.Stat(arg)
+		if statErr == nil && info.IsDir() {
+			err := filepath.Walk(arg, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if fi.IsDir() {
+					return nil
+				}
+				files = append(files, path)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error walking directory %q: %v", arg, err)
 			}
-			s := fmt.Sprintf("%v", replacement)
-			return []byte(s)
+			continue
+		}
+		if statErr == nil {
+			files = append(files, arg)
+			continue
 		}
 
-		expanded = re.ReplaceAllFunc(expanded, expandFunction)
-		if err != nil {
-			return err
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			return nil, fmt.Errorf("error reading file %q: %v", arg, statErr)
 		}
+		files = append(files, matches...)
 	}
 
-	_, err = os.Stdout.Write(expanded)
-	if err != nil {
-		return fmt.Errorf("error writing to stdout: %v", err)
+	return files, nil
+}
+
+// missingKeyMode derives a single MissingKeyMode from the mutually exclusive
+// --strict/--allow-missing/--default-empty flags.
+func (c *ExpandCmd) missingKeyMode() (MissingKeyMode, error) {
+	mode := MissingKeyStrict
+	set := 0
+
+	if c.Strict {
+		mode = MissingKeyStrict
+		set++
+	}
+	if c.AllowMissing {
+		mode = MissingKeyAllow
+		set++
+	}
+	if c.DefaultEmpty {
+		mode = MissingKeyEmpty
+		set++
+	}
+	if set > 1 {
+		return "", fmt.Errorf("only one of --strict, --allow-missing, --default-empty may be set")
 	}
 
-	return nil
+	return mode, nil
 }
 
-func (c *ExpandCmd) parseValues() (map[string]interface{}, error) {
+// parseValues merges every values provider left to right: the legacy
+// -f/--file flags first (in order), then --values-from providers (in
+// order), then -k/--value overrides, which take highest precedence. It also
+// returns the string form of every value contributed by a sensitive
+// provider, for --redact.
+func (c *ExpandCmd) parseValues() (map[string]interface{}, []string, error) {
 	values := make(map[string]interface{})
+	var sensitive []string
 
+	var providers []ValuesProvider
 	for _, f := range c.SourceFiles {
-		b, err := ioutil.ReadFile(f)
+		providers = append(providers, fileValuesProvider{path: f, ignoreMissing: c.IgnoreMissingFiles})
+	}
+	for _, uri := range c.ValuesFrom {
+		p, err := newValuesProvider(uri)
 		if err != nil {
-			if c.IgnoreMissingFiles && os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "Skipping missing file %q\n", f)
-				continue
-			}
-			return nil, fmt.Errorf("error reading file %q: %v", f, err)
+			return nil, nil, err
 		}
+		providers = append(providers, p)
+	}
 
-		data := make(map[string]interface{})
-		if err := yaml.Unmarshal(b, &data); err != nil {
-			return nil, fmt.Errorf("error parsing yaml file %q: %v", f, err)
+	for _, p := range providers {
+		pvalues, isSensitive, err := p.Values()
+		if err != nil {
+			return nil, sensitive, err
 		}
-
-		for k, v := range data {
+		for k, v := range pvalues {
 			values[k] = v
+			if isSensitive {
+				sensitive = append(sensitive, fmt.Sprintf("%v", v))
+			}
 		}
 	}
 
 	for _, v := range c.Values {
 		tokens := strings.SplitN(v, "=", 2)
 		if len(tokens) != 2 {
-			return nil, fmt.Errorf("Unexpected value %q, expected key=value", v)
+			return nil, sensitive, fmt.Errorf("Unexpected value %q, expected key=value", v)
 		}
-		values[tokens[0]] = tokens[1]
+		setNestedValue(values, tokens[0], tokens[1])
 	}
 
-	return values, nil
+	return values, sensitive, nil
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseValuesMergesLeftToRightWithOverridesWinning(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(path, []byte("host: from-file\nport: 5432\n"), 0644); err != nil {
+		t.Fatalf("error writing values file: %v", err)
+	}
+
+	t.Setenv("ENV_HOST", "from-env")
+
+	c := &ExpandCmd{
+		SourceFiles: []string{path},
+		ValuesFrom:  []string{"env://ENV_"},
+		Values:      []string{"host=from-flag"},
+	}
+
+	values, sensitive, err := c.parseValues()
+	if err != nil {
+		t.Fatalf("parseValues returned error: %v", err)
+	}
+	if len(sensitive) != 0 {
+		t.Errorf("parseValues reported sensitive values for non-sensitive providers: %v", sensitive)
+	}
+
+	// -k/--value overrides win over both --file and --values-from.
+	if values["host"] != "from-flag" {
+		t.Errorf(`values["host"] = %v; want "from-flag"`, values["host"])
+	}
+	if values["port"] != float64(5432) {
+		t.Errorf(`values["port"] = %v; want 5432`, values["port"])
+	}
+}
+
+// TestParseValuesPreservesSensitiveListWhenALaterStepErrors exercises the
+// --redact guarantee's weak spot: a sensitive provider (vault://) succeeds
+// first, then a later -k/--value flag is malformed. parseValues must still
+// return the sensitive values already collected, rather than discarding
+// them, so Run's deferred redactError call (registered before parseValues
+// is even invoked) has something to scrub.
+func TestParseValuesPreservesSensitiveListWhenALaterStepErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"data":{"password":"s3cr3t"}}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	c := &ExpandCmd{
+		ValuesFrom: []string{"vault://secret/data/db"},
+		Values:     []string{"malformed-no-equals-sign"},
+	}
+
+	_, sensitive, err := c.parseValues()
+	if err == nil {
+		t.Fatal("parseValues returned no error for a malformed -k/--value flag")
+	}
+	if len(sensitive) != 1 || sensitive[0] != "s3cr3t" {
+		t.Errorf("parseValues sensitive = %v; want [\"s3cr3t\"] preserved despite the later error", sensitive)
+	}
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// resolveKey first looks up key as a literal top-level entry (preserving
+// baseline behavior for values files that use a literal dotted key, e.g.
+// "my.literal.key: hello"), and only if that misses walks it as a dotted
+// path such as "database.primary.host" through a tree of
+// map[string]interface{} and []interface{} (the shape produced by
+// yaml.Unmarshal). Slice elements in a path are addressed by their numeric
+// index, e.g. "hosts.0".
+func resolveKey(values map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := values[key]; ok {
+		return v, true
+	}
+
+	var cur interface{} = values
+	for _, part := range strings.Split(key, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			cur = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// resolveKeyOrEnv resolves key via resolveKey and, if that fails and useEnv
+// is set, falls back to the environment variable named after key, upper-cased
+// with "." replaced by "_" (e.g. "database.primary.host" =>
+// "DATABASE_PRIMARY_HOST"), mirroring envsubst-style tools.
+func resolveKeyOrEnv(values map[string]interface{}, key string, useEnv bool) (interface{}, bool) {
+	if v, ok := resolveKey(values, key); ok {
+		return v, true
+	}
+	if !useEnv {
+		return nil, false
+	}
+
+	envKey := strings.ToUpper(strings.Replace(key, ".", "_", -1))
+	return os.LookupEnv(envKey)
+}
+
+// setNestedValue assigns value at a dotted path within values, creating any
+// intermediate maps that don't already exist. It is the write-side
+// counterpart to resolveKey, used for `--value foo.bar.baz=qux`.
+func setNestedValue(values map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	m := values
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			m[part] = value
+			return
+		}
+
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[part] = next
+		}
+		m = next
+	}
+}
+
+// isComposite reports whether v is a map or slice, i.e. something that can't
+// be substituted as a bare scalar and needs to be serialized instead.
+func isComposite(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// serializeQuoted renders a composite value for the quoted $(key) form: it is
+// marshaled to JSON and then quoted so it can sit inside a YAML/JSON string
+// literal.
+func serializeQuoted(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error serializing value as json: %v", err)
+	}
+	return strconv.Quote(string(b)), nil
+}
+
+// serializeInline renders a composite value for the unquoted $((key)) form as
+// inline YAML, indenting every line after the first to line up with column
+// (the 0-based column the match started at) so the result stays valid YAML
+// when substituted in place.
+func serializeInline(v interface{}, column int) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error serializing value as yaml: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) == 1 {
+		return lines[0], nil
+	}
+
+	indent := strings.Repeat(" ", column)
+	for i := 1; i < len(lines); i++ {
+		lines[i] = indent + lines[i]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// serializeBlockScalar renders v's string form as a YAML literal block
+// scalar ("|"), with every content line indented two spaces past column
+// (the 0-based column the $(key) match starts at, which lies to the right of
+// the key introducing it), so the result embeds safely regardless of what
+// characters the value contains.
+func serializeBlockScalar(v interface{}, column int) string {
+	indent := strings.Repeat(" ", column+2)
+	lines := strings.Split(fmt.Sprintf("%v", v), "\n")
+
+	var buf strings.Builder
+	buf.WriteString("|\n")
+	for _, line := range lines {
+		buf.WriteString(indent)
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
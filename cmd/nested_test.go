@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveKeyLiteralTakesPrecedence(t *testing.T) {
+	values := map[string]interface{}{
+		"my.literal.key": "hello",
+		"my": map[string]interface{}{
+			"literal": map[string]interface{}{
+				"key": "nested",
+			},
+		},
+	}
+
+	v, ok := resolveKey(values, "my.literal.key")
+	if !ok || v != "hello" {
+		t.Fatalf("resolveKey(%q) = %v, %v; want %q, true", "my.literal.key", v, ok, "hello")
+	}
+}
+
+func TestResolveKeyWalksNestedPath(t *testing.T) {
+	values := map[string]interface{}{
+		"database": map[string]interface{}{
+			"primary": map[string]interface{}{
+				"host": "db.example.com",
+			},
+			"hosts": []interface{}{"a", "b", "c"},
+		},
+	}
+
+	if v, ok := resolveKey(values, "database.primary.host"); !ok || v != "db.example.com" {
+		t.Fatalf("resolveKey(database.primary.host) = %v, %v; want %q, true", v, ok, "db.example.com")
+	}
+
+	if v, ok := resolveKey(values, "database.hosts.1"); !ok || v != "b" {
+		t.Fatalf("resolveKey(database.hosts.1) = %v, %v; want %q, true", v, ok, "b")
+	}
+}
+
+func TestResolveKeyMissing(t *testing.T) {
+	values := map[string]interface{}{
+		"database": map[string]interface{}{
+			"host": "db.example.com",
+		},
+	}
+
+	cases := []string{
+		"database.port",
+		"database.host.extra",
+		"database.hosts.5",
+		"missing",
+	}
+	for _, key := range cases {
+		if _, ok := resolveKey(values, key); ok {
+			t.Errorf("resolveKey(%q) unexpectedly found a value", key)
+		}
+	}
+}
+
+func TestResolveKeyOrEnvFallsBackToEnvironment(t *testing.T) {
+	t.Setenv("DATABASE_HOST", "from-env")
+
+	values := map[string]interface{}{}
+
+	if v, ok := resolveKeyOrEnv(values, "database.host", false); ok {
+		t.Fatalf("resolveKeyOrEnv with useEnv=false = %v, %v; want not found", v, ok)
+	}
+
+	v, ok := resolveKeyOrEnv(values, "database.host", true)
+	if !ok || v != "from-env" {
+		t.Fatalf("resolveKeyOrEnv(database.host, true) = %v, %v; want %q, true", v, ok, "from-env")
+	}
+}
+
+func TestSetNestedValue(t *testing.T) {
+	values := map[string]interface{}{}
+	setNestedValue(values, "database.primary.host", "db.example.com")
+	setNestedValue(values, "database.primary.port", "5432")
+
+	want := map[string]interface{}{
+		"database": map[string]interface{}{
+			"primary": map[string]interface{}{
+				"host": "db.example.com",
+				"port": "5432",
+			},
+		},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("setNestedValue produced %#v; want %#v", values, want)
+	}
+}
+
+func TestIsComposite(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want bool
+	}{
+		{map[string]interface{}{"a": 1}, true},
+		{[]interface{}{1, 2}, true},
+		{"scalar", false},
+		{42, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := isComposite(c.v); got != c.want {
+			t.Errorf("isComposite(%#v) = %v; want %v", c.v, got, c.want)
+		}
+	}
+}
+
+func TestSerializeQuoted(t *testing.T) {
+	v := map[string]interface{}{"host": "db.example.com"}
+	s, err := serializeQuoted(v)
+	if err != nil {
+		t.Fatalf("serializeQuoted returned error: %v", err)
+	}
+	if want := `"{\"host\":\"db.example.com\"}"`; s != want {
+		t.Fatalf("serializeQuoted = %s; want %s", s, want)
+	}
+}
+
+func TestSerializeInlineIndentsContinuationLines(t *testing.T) {
+	v := map[string]interface{}{"a": 1, "b": 2}
+	s, err := serializeInline(v, 4)
+	if err != nil {
+		t.Fatalf("serializeInline returned error: %v", err)
+	}
+
+	if want := "a: 1\n    b: 2"; s != want {
+		t.Fatalf("serializeInline = %q; want %q", s, want)
+	}
+}
+
+func TestSerializeInlineScalarIsUnindented(t *testing.T) {
+	s, err := serializeInline("hello", 4)
+	if err != nil {
+		t.Fatalf("serializeInline returned error: %v", err)
+	}
+	if s != "hello" {
+		t.Fatalf("serializeInline(scalar) = %q; want %q", s, "hello")
+	}
+}
+
+func TestSerializeBlockScalar(t *testing.T) {
+	got := serializeBlockScalar("line one\nline two", 2)
+	want := "|\n    line one\n    line two"
+	if got != want {
+		t.Fatalf("serializeBlockScalar = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+// maxRequestBodyBytes caps the size of a POST /expand body, so an oversized
+// upload is cut off instead of being read into memory in full.
+const maxRequestBodyBytes = 10 << 20 // 10MiB
+
+// readTimeout and writeTimeout bound how long a single request may take end
+// to end, on top of the body size cap.
+const (
+	readTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// ServeCmd exposes kexpand's expansion pipeline over HTTP, for callers (CI
+// systems, admission webhooks) that would rather call a service than shell
+// out to the CLI per file.
+type ServeCmd struct {
+	cobraCommand *cobra.Command
+
+	Addr    string
+	TLSCert string
+	TLSKey  string
+}
+
+var serveCmd = ServeCmd{
+	cobraCommand: &cobra.Command{
+		Use:   "serve",
+		Short: "Serve template expansion over HTTP",
+	},
+}
+
+func init() {
+	cmd := serveCmd.cobraCommand
+	rootCommand.cobraCommand.AddCommand(cmd)
+
+	cmd.Flags().StringVar(&serveCmd.Addr, "addr", ":8080", "address to listen on")
+	cmd.Flags().StringVar(&serveCmd.TLSCert, "tls-cert", "", "TLS certificate file, enables HTTPS")
+	cmd.Flags().StringVar(&serveCmd.TLSKey, "tls-key", "", "TLS key file, enables HTTPS")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		err := serveCmd.Run(args)
+		if err != nil {
+			glog.Exitf("%v", err)
+		}
+	}
+}
+
+func (c *ServeCmd) Run(args []string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/expand", handleExpand)
+
+	server := &http.Server{
+		Addr:         c.Addr,
+		Handler:      mux,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+
+	glog.Infof("listening on %s", c.Addr)
+
+	if c.TLSCert != "" || c.TLSKey != "" {
+		if c.TLSCert == "" || c.TLSKey == "" {
+			return fmt.Errorf("both --tls-cert and --tls-key must be set to serve over TLS")
+		}
+		return server.ListenAndServeTLS(c.TLSCert, c.TLSKey)
+	}
+
+	return server.ListenAndServe()
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "ok")
+}
+
+// expandRequest is the POST /expand body: a template plus the values to
+// substitute into it, an optional engine name (see the --engine flag), and
+// the same --validate/--output-format options the CLI exposes, so a request
+// handled here behaves exactly like the equivalent `kexpand expand` call.
+// It's parsed with ghodss/yaml so callers may send either JSON or YAML.
+type expandRequest struct {
+	Template     string                 `json:"template"`
+	Values       map[string]interface{} `json:"values"`
+	Engine       string                 `json:"engine"`
+	Validate     bool                   `json:"validate"`
+	OutputFormat string                 `json:"outputFormat"`
+}
+
+func handleExpand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req expandRequest
+	if err := yaml.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	engine, err := newEngine(req.Engine)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expanded, err := Expand(engine, []byte(req.Template), req.Values, ExpandOptions{
+		File:           "<request>",
+		MissingKeyMode: MissingKeyStrict,
+	}, req.Validate, req.OutputFormat)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(expanded)
+}
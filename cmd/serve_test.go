@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleHealthzReturnsOK(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w.Body.String() != "ok" {
+		t.Fatalf("body = %q; want %q", w.Body.String(), "ok")
+	}
+}
+
+func TestHandleExpandRejectsNonPost(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodGet, "/expand", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandleExpandJSONBodyHappyPath(t *testing.T) {
+	body := `{"template":"host: $(host)\n","values":{"host":"db.example.com"}}`
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodPost, "/expand", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d, body = %q", w.Code, http.StatusOK, w.Body.String())
+	}
+	if want := "host: \"db.example.com\"\n"; w.Body.String() != want {
+		t.Fatalf("body = %q; want %q", w.Body.String(), want)
+	}
+}
+
+func TestHandleExpandInvalidBodyReturnsBadRequest(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodPost, "/expand", strings.NewReader("not: [valid")))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleExpandMissingKeyReturnsUnprocessableEntity(t *testing.T) {
+	body := `{"template":"host: $(host)\n"}`
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodPost, "/expand", strings.NewReader(body)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d, body = %q", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+	}
+}
+
+func TestHandleExpandValidatesOutputWhenRequested(t *testing.T) {
+	body := `{"template":"a: [1, 2\n","validate":true}`
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodPost, "/expand", strings.NewReader(body)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d, body = %q", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "invalid yaml") {
+		t.Fatalf("body = %q; want it to mention invalid yaml", w.Body.String())
+	}
+}
+
+func TestHandleExpandReformatsOutputWhenRequested(t *testing.T) {
+	body := `{"template":"a: 1\nb: two\n","outputFormat":"json"}`
+	w := httptest.NewRecorder()
+	handleExpand(w, httptest.NewRequest(http.MethodPost, "/expand", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d, body = %q", w.Code, http.StatusOK, w.Body.String())
+	}
+	if want := "{\"a\":1,\"b\":\"two\"}\n"; w.Body.String() != want {
+		t.Fatalf("body = %q; want %q", w.Body.String(), want)
+	}
+}
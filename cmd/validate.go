@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// yamlErrorLineRE picks the line number gopkg.in/yaml.v2 embeds in its own
+// error messages (e.g. "yaml: line 2: mapping values are not allowed..."),
+// which is relative to the start of the sub-document it was parsing.
+var yamlErrorLineRE = regexp.MustCompile(`line (\d+)`)
+
+// yamlDocument is one "---"-delimited document within a larger byte stream,
+// along with the line it starts on (1-based), so parse errors can be
+// reported against the original output rather than just the sub-document.
+type yamlDocument struct {
+	content   []byte
+	startLine int
+}
+
+// splitYAMLDocuments splits data on lines that are exactly "---", the
+// standard YAML document separator.
+func splitYAMLDocuments(data []byte) []yamlDocument {
+	lines := strings.Split(string(data), "\n")
+
+	var docs []yamlDocument
+	var current []string
+	startLine := 1
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		docs = append(docs, yamlDocument{content: []byte(strings.Join(current, "\n")), startLine: startLine})
+		current = nil
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			flush()
+			startLine = i + 2
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return docs
+}
+
+// Expand runs engine over src and values, then applies the same optional
+// post-processing the expand command exposes via --validate/--output-format.
+// It is the one pipeline both the CLI and the serve command use, so a
+// request handled by the server behaves identically to one run through the
+// CLI with the same options.
+func Expand(engine Engine, src []byte, values map[string]interface{}, opts ExpandOptions, validate bool, outputFormat string) ([]byte, error) {
+	expanded, err := engine.Expand(src, values, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if validate {
+		if err := validateYAML(expanded); err != nil {
+			return nil, fmt.Errorf("%s: %v", opts.File, err)
+		}
+	}
+
+	if outputFormat != "" {
+		expanded, err = reformatOutput(expanded, outputFormat)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", opts.File, err)
+		}
+	}
+
+	return expanded, nil
+}
+
+// validateYAML parses expanded as one or more "---"-delimited YAML
+// documents and returns an error naming the exact output line the failure
+// occurred on. This catches the common case where an unquoted $((key))
+// substitution produced a value that breaks YAML syntax.
+func validateYAML(expanded []byte) error {
+	for _, doc := range splitYAMLDocuments(expanded) {
+		var v interface{}
+		if err := yaml.Unmarshal(doc.content, &v); err != nil {
+			return fmt.Errorf("line %d: invalid yaml: %v", yamlErrorLine(doc, err), err)
+		}
+	}
+	return nil
+}
+
+// yamlErrorLine translates a yaml.Unmarshal error's line number, which is
+// relative to the start of doc.content, into the corresponding absolute line
+// in the original source. It falls back to doc.startLine if err doesn't
+// carry a line number of its own (e.g. unexpected EOF).
+func yamlErrorLine(doc yamlDocument, err error) int {
+	m := yamlErrorLineRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return doc.startLine
+	}
+
+	inner, convErr := strconv.Atoi(m[1])
+	if convErr != nil {
+		return doc.startLine
+	}
+
+	return doc.startLine + inner - 1
+}
+
+// reformatOutput re-parses expanded as YAML documents and re-serializes them
+// canonically as format ("yaml", "json", or "json-lines").
+func reformatOutput(expanded []byte, format string) ([]byte, error) {
+	docs := splitYAMLDocuments(expanded)
+	values := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		if err := yaml.Unmarshal(doc.content, &values[i]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid yaml: %v", yamlErrorLine(doc, err), err)
+		}
+	}
+
+	switch format {
+	case "yaml":
+		var buf bytes.Buffer
+		for i, v := range values {
+			if i > 0 {
+				buf.WriteString("---\n")
+			}
+			b, err := yaml.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("error serializing document %d as yaml: %v", i, err)
+			}
+			buf.Write(b)
+		}
+		return buf.Bytes(), nil
+
+	case "json":
+		var out interface{} = values
+		if len(values) == 1 {
+			out = values[0]
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing documents as json: %v", err)
+		}
+		return append(b, '\n'), nil
+
+	case "json-lines":
+		var buf bytes.Buffer
+		for _, v := range values {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("error serializing document as json: %v", err)
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown --output-format %q (expected json, yaml, or json-lines)", format)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitYAMLDocuments(t *testing.T) {
+	data := []byte("a: 1\n---\nb: 2\nc: 3\n---\nd: 4\n")
+
+	docs := splitYAMLDocuments(data)
+	if len(docs) != 3 {
+		t.Fatalf("got %d documents, want 3", len(docs))
+	}
+
+	if string(docs[0].content) != "a: 1" || docs[0].startLine != 1 {
+		t.Errorf("doc 0 = %+v", docs[0])
+	}
+	if string(docs[1].content) != "b: 2\nc: 3" || docs[1].startLine != 3 {
+		t.Errorf("doc 1 = %+v", docs[1])
+	}
+	if string(docs[2].content) != "d: 4\n" || docs[2].startLine != 6 {
+		t.Errorf("doc 2 = %+v", docs[2])
+	}
+}
+
+func TestValidateYAMLAcceptsValidDocuments(t *testing.T) {
+	data := []byte("a: 1\n---\nb: 2\n")
+	if err := validateYAML(data); err != nil {
+		t.Fatalf("validateYAML returned error for valid input: %v", err)
+	}
+}
+
+func TestValidateYAMLReportsFailingDocumentLine(t *testing.T) {
+	data := []byte("a: 1\n---\nb: [1, 2\n")
+
+	err := validateYAML(data)
+	if err == nil {
+		t.Fatal("validateYAML returned no error for invalid yaml")
+	}
+	if !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Fatalf("validateYAML error = %q; want it to start with %q", err.Error(), "line 3:")
+	}
+}
+
+func TestValidateYAMLReportsFailingLineWithinALaterMultiLineDocument(t *testing.T) {
+	// The second document starts on line 3, and the syntax error is on its
+	// second line (file line 4), not its first (file line 3) -- the
+	// coincidental case TestValidateYAMLReportsFailingDocumentLine covers.
+	data := []byte("a: 1\n---\nb: 2\nc: [1,2\n")
+
+	err := validateYAML(data)
+	if err == nil {
+		t.Fatal("validateYAML returned no error for invalid yaml")
+	}
+	if !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Fatalf("validateYAML error = %q; want it to start with %q", err.Error(), "line 4:")
+	}
+}
+
+func TestReformatOutputJSONSingleDocument(t *testing.T) {
+	out, err := reformatOutput([]byte("a: 1\nb: two\n"), "json")
+	if err != nil {
+		t.Fatalf("reformatOutput returned error: %v", err)
+	}
+	if want := "{\"a\":1,\"b\":\"two\"}\n"; string(out) != want {
+		t.Fatalf("reformatOutput = %q; want %q", out, want)
+	}
+}
+
+func TestReformatOutputJSONMultipleDocumentsProducesArray(t *testing.T) {
+	out, err := reformatOutput([]byte("a: 1\n---\nb: 2\n"), "json")
+	if err != nil {
+		t.Fatalf("reformatOutput returned error: %v", err)
+	}
+	if want := "[{\"a\":1},{\"b\":2}]\n"; string(out) != want {
+		t.Fatalf("reformatOutput = %q; want %q", out, want)
+	}
+}
+
+func TestReformatOutputJSONLines(t *testing.T) {
+	out, err := reformatOutput([]byte("a: 1\n---\nb: 2\n"), "json-lines")
+	if err != nil {
+		t.Fatalf("reformatOutput returned error: %v", err)
+	}
+	if want := "{\"a\":1}\n{\"b\":2}\n"; string(out) != want {
+		t.Fatalf("reformatOutput = %q; want %q", out, want)
+	}
+}
+
+func TestReformatOutputYAML(t *testing.T) {
+	out, err := reformatOutput([]byte("a: 1\n---\nb: 2\n"), "yaml")
+	if err != nil {
+		t.Fatalf("reformatOutput returned error: %v", err)
+	}
+	if want := "a: 1\n---\nb: 2\n"; string(out) != want {
+		t.Fatalf("reformatOutput = %q; want %q", out, want)
+	}
+}
+
+func TestReformatOutputUnknownFormat(t *testing.T) {
+	if _, err := reformatOutput([]byte("a: 1\n"), "toml"); err == nil {
+		t.Fatal("reformatOutput returned no error for an unknown format")
+	}
+}
+
+func TestReformatOutputInvalidYAML(t *testing.T) {
+	if _, err := reformatOutput([]byte("a: [1, 2\n"), "json"); err == nil {
+		t.Fatal("reformatOutput returned no error for invalid yaml")
+	}
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/ghodss/yaml"
+)
+
+// ValuesProvider loads a set of key/value pairs to be merged into the values
+// map that templates are expanded against. Providers that read from a
+// secret store return sensitive=true so their values can be scrubbed from
+// error output with --redact.
+type ValuesProvider interface {
+	Values() (values map[string]interface{}, sensitive bool, err error)
+}
+
+// newValuesProvider parses a --values-from URI into the ValuesProvider it
+// names. Recognized forms:
+//
+//	file://path.yaml       a YAML/JSON values file
+//	env://PREFIX_          environment variables starting with PREFIX_
+//	vault://secret/data/foo  a Vault KV v2 secret (VAULT_ADDR/VAULT_TOKEN)
+//	awssm://my/secret       an AWS Secrets Manager secret
+//	ssm:///path/prefix      an AWS SSM parameter path, read recursively
+//	json:-                  a JSON object read from stdin
+func newValuesProvider(uri string) (ValuesProvider, error) {
+	if uri == "json:-" {
+		return jsonStdinProvider{}, nil
+	}
+
+	tokens := strings.SplitN(uri, "://", 2)
+	if len(tokens) != 2 {
+		return nil, fmt.Errorf("--values-from %q: expected a URI like scheme://... or json:-", uri)
+	}
+	scheme, rest := tokens[0], tokens[1]
+
+	switch scheme {
+	case "file":
+		return fileValuesProvider{path: rest}, nil
+	case "env":
+		return envValuesProvider{prefix: rest}, nil
+	case "vault":
+		return vaultValuesProvider{path: rest}, nil
+	case "awssm":
+		return awsSecretsManagerProvider{secretID: rest}, nil
+	case "ssm":
+		return ssmValuesProvider{path: "/" + strings.TrimPrefix(rest, "/")}, nil
+	default:
+		return nil, fmt.Errorf("--values-from %q: unknown scheme %q", uri, scheme)
+	}
+}
+
+// fileValuesProvider reads a YAML (or JSON, since YAML is a superset) values
+// file, same as the historical -f/--file flag.
+type fileValuesProvider struct {
+	path          string
+	ignoreMissing bool
+}
+
+func (p fileValuesProvider) Values() (map[string]interface{}, bool, error) {
+	b, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		if p.ignoreMissing && os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Skipping missing file %q\n", p.path)
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error reading file %q: %v", p.path, err)
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, false, fmt.Errorf("error parsing yaml file %q: %v", p.path, err)
+	}
+
+	return values, false, nil
+}
+
+// envValuesProvider contributes every environment variable starting with
+// prefix, lower-cased and with the prefix stripped, e.g. DB_HOST=x under
+// prefix "DB_" becomes key "host".
+type envValuesProvider struct {
+	prefix string
+}
+
+func (p envValuesProvider) Values() (map[string]interface{}, bool, error) {
+	values := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		tokens := strings.SplitN(kv, "=", 2)
+		if len(tokens) != 2 || !strings.HasPrefix(tokens[0], p.prefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(tokens[0], p.prefix))
+		values[key] = tokens[1]
+	}
+	return values, false, nil
+}
+
+// jsonStdinProvider reads a single JSON object from stdin, for "json:-".
+type jsonStdinProvider struct{}
+
+func (jsonStdinProvider) Values() (map[string]interface{}, bool, error) {
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading json values from stdin: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, false, fmt.Errorf("error parsing json values from stdin: %v", err)
+	}
+
+	return values, false, nil
+}
+
+// vaultValuesProvider reads a KV v2 secret from Vault, addressed by
+// VAULT_ADDR and authenticated with VAULT_TOKEN.
+type vaultValuesProvider struct {
+	path string
+}
+
+func (p vaultValuesProvider) Values() (map[string]interface{}, bool, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, true, fmt.Errorf("VAULT_ADDR must be set to use vault:// values providers")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, true, fmt.Errorf("VAULT_TOKEN must be set to use vault:// values providers")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+p.path, nil)
+	if err != nil {
+		return nil, true, fmt.Errorf("error building vault request for %q: %v", p.path, err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("error reading vault secret %q: %v", p.path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, true, fmt.Errorf("vault returned %s for %q", resp.Status, p.path)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, true, fmt.Errorf("error parsing vault response for %q: %v", p.path, err)
+	}
+
+	return body.Data.Data, true, nil
+}
+
+// awsSecretsManagerProvider reads a secret from AWS Secrets Manager. If the
+// secret string is a JSON object its keys are merged in directly; otherwise
+// the whole string becomes the value of a single key named after the
+// secret's last path segment.
+type awsSecretsManagerProvider struct {
+	secretID string
+}
+
+func (p awsSecretsManagerProvider) Values() (map[string]interface{}, bool, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, true, fmt.Errorf("error creating aws session: %v", err)
+	}
+
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.secretID),
+	})
+	if err != nil {
+		return nil, true, fmt.Errorf("error reading secret %q: %v", p.secretID, err)
+	}
+
+	if out.SecretString == nil {
+		return nil, true, fmt.Errorf("secret %q has no string value", p.secretID)
+	}
+
+	values := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(*out.SecretString), &values); err != nil {
+		values = map[string]interface{}{path.Base(p.secretID): *out.SecretString}
+	}
+
+	return values, true, nil
+}
+
+// ssmValuesProvider reads every parameter under an AWS SSM parameter path,
+// recursively, keyed by the portion of each name after path.
+type ssmValuesProvider struct {
+	path string
+}
+
+func (p ssmValuesProvider) Values() (map[string]interface{}, bool, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, true, fmt.Errorf("error creating aws session: %v", err)
+	}
+	svc := ssm.New(sess)
+
+	values := make(map[string]interface{})
+	trimPrefix := strings.TrimRight(p.path, "/") + "/"
+
+	var nextToken *string
+	for {
+		out, err := svc.GetParametersByPath(&ssm.GetParametersByPathInput{
+			Path:           aws.String(p.path),
+			Recursive:      aws.Bool(true),
+			WithDecryption: aws.Bool(true),
+			NextToken:      nextToken,
+		})
+		if err != nil {
+			return nil, true, fmt.Errorf("error reading ssm parameters under %q: %v", p.path, err)
+		}
+
+		for _, param := range out.Parameters {
+			key := strings.TrimPrefix(aws.StringValue(param.Name), trimPrefix)
+			values[key] = aws.StringValue(param.Value)
+		}
+
+		if out.NextToken == nil {
+			break
+		}
+		nextToken = out.NextToken
+	}
+
+	return values, true, nil
+}
+
+// redactError replaces every occurrence of a sensitive value's string form
+// in err's message with "REDACTED", for --redact.
+func redactError(err error, sensitive []string) error {
+	if err == nil || len(sensitive) == 0 {
+		return err
+	}
+
+	msg := err.Error()
+	for _, s := range sensitive {
+		if s == "" {
+			continue
+		}
+		msg = strings.Replace(msg, s, "REDACTED", -1)
+	}
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileValuesProviderReadsYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(path, []byte("host: db.example.com\nport: 5432\n"), 0644); err != nil {
+		t.Fatalf("error writing values file: %v", err)
+	}
+
+	p := fileValuesProvider{path: path}
+	values, sensitive, err := p.Values()
+	if err != nil {
+		t.Fatalf("Values() returned error: %v", err)
+	}
+	if sensitive {
+		t.Error("fileValuesProvider reported sensitive=true; want false")
+	}
+	if values["host"] != "db.example.com" || values["port"] != float64(5432) {
+		t.Errorf("Values() = %#v", values)
+	}
+}
+
+func TestFileValuesProviderMissingFile(t *testing.T) {
+	p := fileValuesProvider{path: "/does/not/exist.yaml"}
+	if _, _, err := p.Values(); err == nil {
+		t.Fatal("Values() returned no error for a missing file")
+	}
+}
+
+func TestFileValuesProviderIgnoreMissingFile(t *testing.T) {
+	p := fileValuesProvider{path: "/does/not/exist.yaml", ignoreMissing: true}
+	values, _, err := p.Values()
+	if err != nil {
+		t.Fatalf("Values() returned error despite ignoreMissing: %v", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("Values() = %#v; want empty", values)
+	}
+}
+
+func TestEnvValuesProviderFiltersAndStripsPrefix(t *testing.T) {
+	t.Setenv("DB_HOST", "db.example.com")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("OTHER_VAR", "ignored")
+
+	p := envValuesProvider{prefix: "DB_"}
+	values, sensitive, err := p.Values()
+	if err != nil {
+		t.Fatalf("Values() returned error: %v", err)
+	}
+	if sensitive {
+		t.Error("envValuesProvider reported sensitive=true; want false")
+	}
+	if values["host"] != "db.example.com" || values["port"] != "5432" {
+		t.Errorf("Values() = %#v", values)
+	}
+	if _, ok := values["other_var"]; ok {
+		t.Errorf("Values() unexpectedly included a variable outside the prefix: %#v", values)
+	}
+}
+
+func TestNewValuesProviderDispatchesByScheme(t *testing.T) {
+	if _, err := newValuesProvider("json:-"); err != nil {
+		t.Errorf("json:- returned error: %v", err)
+	}
+
+	cases := []struct {
+		uri      string
+		wantType string
+	}{
+		{"file://values.yaml", "cmd.fileValuesProvider"},
+		{"env://PREFIX_", "cmd.envValuesProvider"},
+		{"vault://secret/data/foo", "cmd.vaultValuesProvider"},
+		{"awssm://my/secret", "cmd.awsSecretsManagerProvider"},
+		{"ssm:///path/prefix", "cmd.ssmValuesProvider"},
+	}
+	for _, c := range cases {
+		p, err := newValuesProvider(c.uri)
+		if err != nil {
+			t.Errorf("newValuesProvider(%q) returned error: %v", c.uri, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", p); got != c.wantType {
+			t.Errorf("newValuesProvider(%q) = %s; want %s", c.uri, got, c.wantType)
+		}
+	}
+
+	if _, err := newValuesProvider("nonsense"); err == nil {
+		t.Error(`newValuesProvider("nonsense") returned no error`)
+	}
+	if _, err := newValuesProvider("bogus://x"); err == nil {
+		t.Error(`newValuesProvider("bogus://x") returned no error for an unknown scheme`)
+	}
+}
+
+func TestRedactErrorScrubsEverySensitiveValue(t *testing.T) {
+	err := fmt.Errorf("vault returned secret %q for path %q", "s3cr3t", "db/password")
+	redacted := redactError(err, []string{"s3cr3t"})
+	if redacted.Error() != `vault returned secret "REDACTED" for path "db/password"` {
+		t.Errorf("redactError = %q", redacted.Error())
+	}
+}
+
+func TestRedactErrorNoopWithoutSensitiveValues(t *testing.T) {
+	err := fmt.Errorf("boom")
+	if redactError(err, nil) != err {
+		t.Error("redactError changed an error when no sensitive values were given")
+	}
+	if redactError(nil, []string{"x"}) != nil {
+		t.Error("redactError returned a non-nil error for a nil input")
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+// watchDebounce is how long to wait after the last filesystem event before
+// re-expanding, so a burst of writes (e.g. an editor's save-then-touch)
+// triggers a single re-run.
+const watchDebounce = 100 * time.Millisecond
+
+// watch re-expands the files/directories in args every time one of them
+// changes, optionally running --on-change afterwards. It never returns
+// unless the watcher itself fails.
+func (c *ExpandCmd) watch(args []string, values map[string]interface{}, run expandRun) error {
+	if len(args) == 0 {
+		return fmt.Errorf("--watch requires at least one file or directory argument")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	for _, arg := range args {
+		if err := addWatches(watcher, arg); err != nil {
+			return fmt.Errorf("error watching %q: %v", arg, err)
+		}
+	}
+
+	// written tracks the content hash of every destination file this tool
+	// wrote on the last run, so a --watch combined with --in-place (or any
+	// --output-dir/--suffix destination that lands inside a watched
+	// directory) doesn't re-trigger on its own writes forever.
+	written := make(map[string][sha256.Size]byte)
+
+	reexpand := func() {
+		w, err := c.runOnce(args, values, run)
+		if err != nil {
+			glog.Errorf("%v", err)
+			return
+		}
+		written = w
+		if c.OnChange != "" {
+			if err := runOnChange(c.OnChange); err != nil {
+				glog.Errorf("error running --on-change command: %v", err)
+			}
+		}
+	}
+
+	reexpand()
+
+	var timer *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			glog.V(2).Infof("watch event: %v", event)
+
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatches(watcher, event.Name); err != nil {
+						glog.Errorf("error watching new directory %q: %v", event.Name, err)
+					}
+				}
+			}
+
+			if selfTriggered(event.Name, written) {
+				glog.V(2).Infof("ignoring event for %q: matches what this tool just wrote", event.Name)
+				continue
+			}
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(watchDebounce, reexpand)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			glog.Errorf("watch error: %v", err)
+		}
+	}
+}
+
+// selfTriggered reports whether path's current on-disk content matches the
+// hash this tool itself wrote there on the last run, meaning the fsnotify
+// event was caused by that write rather than an external edit.
+func selfTriggered(path string, written map[string][sha256.Size]byte) bool {
+	want, ok := written[path]
+	if !ok {
+		return false
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	return sha256.Sum256(content) == want
+}
+
+// addWatches registers path with watcher. If path is a directory, every
+// subdirectory beneath it (including itself) is registered too, since
+// fsnotify watches are not recursive on their own and manifest trees
+// routinely nest (e.g. base/overlays).
+func addWatches(watcher *fsnotify.Watcher, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return watcher.Add(path)
+	}
+
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		return watcher.Add(p)
+	})
+}
+
+// runOnce expands every file matched by args exactly once, writing to
+// stdout or to a destination file per the usual output flags. It returns the
+// content hash of every destination file it wrote, keyed by path, so --watch
+// can recognize its own writes.
+func (c *ExpandCmd) runOnce(args []string, values map[string]interface{}, run expandRun) (map[string][sha256.Size]byte, error) {
+	files, err := collectSourceFiles(args)
+	if err != nil {
+		return nil, err
+	}
+
+	written := make(map[string][sha256.Size]byte)
+	for _, f := range files {
+		if !c.writesToDestination() {
+			if err := c.expandFileToStdout(f, values, run); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		dest, expanded, err := c.expandFileToDestination(f, values, run)
+		if err != nil {
+			return nil, err
+		}
+		written[dest] = sha256.Sum256(expanded)
+	}
+
+	return written, nil
+}
+
+func runOnChange(command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
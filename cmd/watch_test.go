@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestSelfTriggeredMatchesLastWrittenContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.yaml")
+	content := []byte("host: db.example.com\n")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("error writing test file: %v", err)
+	}
+
+	written := map[string][sha256.Size]byte{path: sha256.Sum256(content)}
+
+	if !selfTriggered(path, written) {
+		t.Fatal("selfTriggered = false; want true for unchanged content")
+	}
+}
+
+func TestSelfTriggeredFalseOnExternalEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.yaml")
+	original := []byte("host: db.example.com\n")
+	if err := ioutil.WriteFile(path, original, 0644); err != nil {
+		t.Fatalf("error writing test file: %v", err)
+	}
+
+	written := map[string][sha256.Size]byte{path: sha256.Sum256(original)}
+
+	if err := ioutil.WriteFile(path, []byte("host: edited.example.com\n"), 0644); err != nil {
+		t.Fatalf("error editing test file: %v", err)
+	}
+
+	if selfTriggered(path, written) {
+		t.Fatal("selfTriggered = true; want false after an external edit")
+	}
+}
+
+func TestSelfTriggeredFalseForUntrackedPath(t *testing.T) {
+	if selfTriggered("/does/not/exist.yaml", map[string][sha256.Size]byte{}) {
+		t.Fatal("selfTriggered = true for a path that was never written")
+	}
+}
+
+func TestRunOnceTracksWrittenDestinationHashes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.yaml")
+	if err := ioutil.WriteFile(src, []byte("host: $(host)\n"), 0644); err != nil {
+		t.Fatalf("error writing source file: %v", err)
+	}
+
+	c := &ExpandCmd{InPlace: true}
+	run := expandRun{engine: kexpandEngine{}, mode: MissingKeyStrict}
+	values := map[string]interface{}{"host": "db.example.com"}
+
+	written, err := c.runOnce([]string{src}, values, run)
+	if err != nil {
+		t.Fatalf("runOnce returned error: %v", err)
+	}
+
+	out, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatalf("error reading expanded file: %v", err)
+	}
+
+	wantHash := sha256.Sum256(out)
+	if got, ok := written[src]; !ok || got != wantHash {
+		t.Fatalf("written[%q] = %v, %v; want %v, true", src, got, ok, wantHash)
+	}
+
+	// A second run against the now-expanded file produces identical output
+	// (the placeholder is already gone), so --watch would see this exact
+	// scenario on its own rewrite: the event must be recognized as
+	// self-triggered rather than looping forever.
+	if !selfTriggered(src, written) {
+		t.Fatal("selfTriggered = false for the file runOnce just wrote")
+	}
+}
+
+func TestAddWatchesRegistersSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("error creating subdirectory: %v", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("error creating watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := addWatches(watcher, dir); err != nil {
+		t.Fatalf("addWatches returned error: %v", err)
+	}
+
+	watched := watcher.WatchList()
+	want := map[string]bool{dir: false, sub: false}
+	for _, w := range watched {
+		if _, ok := want[w]; ok {
+			want[w] = true
+		}
+	}
+	for path, found := range want {
+		if !found {
+			t.Errorf("addWatches did not register %q; watch list = %v", path, watched)
+		}
+	}
+}